@@ -0,0 +1,139 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"exp/locale/collate"
+	"testing"
+)
+
+// contractionBlock returns the n collation elements t.contractElem records
+// for starter, where n is the number of entries (in b) that share starter
+// as their first rune.
+func contractionBlock(b *Builder, t *table, starter rune) []uint32 {
+	e := b.entryMap[string(starter)]
+	n := 0
+	for _, ent := range b.entry {
+		if ent.runes[0] == starter {
+			n++
+		}
+	}
+	return t.contractElem[e.contractionIndex : e.contractionIndex+n]
+}
+
+// TestBuildSharedStarterContraction exercises the pipeline Build and Print
+// both use (root, tailor, finish, diffOverlay) for the case that broke it:
+// a tailoring that adds a brand new contraction under a starter rune the
+// root table already contracts on. Growing that starter's block can only
+// leave full.contractElem a true append-only extension of root.contractElem
+// if finish seeds the tailored build from root, which is what this test
+// guards.
+func TestBuildSharedStarterContraction(t *testing.T) {
+	b := NewBuilder()
+	// Two starters, 'c' and 'e', each already beginning a contraction with
+	// the same suffix "b" -- a shape common enough in real CLDR data that
+	// the two starters end up sharing a single contraction trie handle.
+	for _, e := range []struct {
+		s  string
+		ce []int
+	}{
+		{"c", []int{10, 20, 2}},
+		{"cb", []int{11, 20, 2}},
+		{"e", []int{30, 20, 2}},
+		{"eb", []int{31, 20, 2}},
+	} {
+		if err := b.Add([]rune(e.s), [][]int{e.ce}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tailor "x" to add a new contraction "cd" under 'c'. 'e' is left
+	// completely untouched by the tailoring.
+	const locale = "x"
+	if err := b.AddTailoring(locale, "c", "cd", collate.Primary); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := b.root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb, err := b.tailor(locale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := nb.finish(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root's data must still be there, at the same offsets: the tailoring
+	// never touched 'e', so full.contractElem must extend root's array
+	// rather than relocate any of it.
+	if len(full.contractElem) < len(root.contractElem) {
+		t.Fatalf("full.contractElem has %d elements; fewer than root's %d", len(full.contractElem), len(root.contractElem))
+	}
+	for i, want := range root.contractElem {
+		if got := full.contractElem[i]; got != want {
+			t.Fatalf("full.contractElem[%d] = %d; want %d (root's own data); a tailoring of one starter must not relocate another starter's contraction block", i, got, want)
+		}
+	}
+
+	// Build the same tailoring a second, independent way: finish it with no
+	// root to seed from, i.e. exactly "building the full table directly".
+	// The two builds lay out contractElem differently -- direct's 'c' block
+	// grows in place, shifting 'e' -- but the actual collation elements
+	// recorded for each starter must be the same either way.
+	nb2, err := b.tailor(locale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := nb2.finish(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, starter := range []rune{'c', 'e'} {
+		got := contractionBlock(nb, full, starter)
+		want := contractionBlock(nb2, direct, starter)
+		if len(got) != len(want) {
+			t.Fatalf("starter %q: contraction block = %v; want %v", starter, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("starter %q: contraction block = %v; want %v", starter, got, want)
+			}
+		}
+	}
+
+	ov, err := b.diffOverlay(locale, nb, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 'e' was never tailored: if it shows up in the overlay anyway, some
+	// unrelated starter's block shifted and diffOverlay mistook the shift
+	// for a real change.
+	if ce, ok := ov.Index['e']; ok {
+		t.Errorf("ov.Index contains untouched starter 'e' (ce=%#x); its contraction data must not have moved", ce)
+	}
+
+	// 'c' must be overlaid: its contraction set grew from {"b"} to
+	// {"b", "d"}, so root's collation element for 'c' no longer applies.
+	if _, ok := ov.Index['c']; !ok {
+		t.Fatalf("ov.Index is missing 'c', whose contraction set grew to include the new \"cd\"")
+	}
+
+	// ov.ContractElem must hold exactly the data appended past root's, not
+	// a stale tail grabbed from a relocated block.
+	want := full.contractElem[len(root.contractElem):]
+	if len(ov.ContractElem) != len(want) {
+		t.Fatalf("ov.ContractElem = %v; want %v", ov.ContractElem, want)
+	}
+	for i := range want {
+		if ov.ContractElem[i] != want[i] {
+			t.Errorf("ov.ContractElem = %v; want %v", ov.ContractElem, want)
+		}
+	}
+}
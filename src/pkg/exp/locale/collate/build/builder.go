@@ -12,17 +12,9 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"unicode"
 )
 
-// TODO: optimizations:
-// - expandElem is currently 20K. By putting unique colElems in a separate
-//   table and having a byte array of indexes into this table, we can reduce
-//   the total size to about 7K. By also factoring out the length bytes, we
-//   can reduce this to about 6K.
-// - trie valueBlocks are currently 100K. There are a lot of sparse blocks
-//   and many consecutive values with the same stride. This can be further
-//   compacted.
-
 // entry is used to keep track of a single entry in the collation element table
 // during building. Examples of entries can be found in the Default Unicode
 // Collation Element Table.
@@ -69,12 +61,54 @@ type Builder struct {
 	entry    []*entry
 	t        *table
 	err      error
+
+	tailoring map[string][]tailor // locale -> tailorings, in AddTailoring order
+	rootTable *table              // cache for root, see (*Builder).root
+
+	settings   map[string]Settings // locale -> settings parsed from CLDR
+	cldrSource map[string]string   // locale -> raw ICU rule string, for [import] resets
+
+	// Gap-allocation state used while applying tailorings for a single
+	// locale. These are only ever populated on the private Builder created
+	// by tailor, never on the Builder the user calls Add/AddTailoring on.
+	primaries     []int
+	primaryUsed   map[int]int
+	secondaryUsed map[[2]int]int
+	tertiaryUsed  map[[3]int]int
+
+	// expandCEIndex interns CE runs appended by appendExpansion, so that
+	// entries whose encoded CEs turn out identical share a single run in
+	// t.expandCE instead of each getting their own copy. It is rebuilt
+	// from scratch for every table a Builder produces, same as the Used
+	// maps above.
+	expandCEIndex map[string]uint16
+}
+
+// primaryGap bounds the weight range after (for nextPrimary) or before (for
+// prevPrimary) each root primary weight from which tailorings draw new
+// primaries, so that they can be inserted without renumbering the rest of
+// the table.  Root primaries are not spread apart to make room: the range
+// also ends at the neighbouring root primary, and is empty where two root
+// primaries are adjacent.
+const primaryGap = 4
+
+// tailor records a single x <_level y tailoring rule for a locale.  before
+// reverses the rule to mean "insert y immediately before x"; it is only
+// produced by the CLDR [before N] syntax and is not reachable from the
+// exported AddTailoring API.
+type tailor struct {
+	x, y   string
+	level  collate.Level
+	before bool
 }
 
 // NewBuilder returns a new Builder.
 func NewBuilder() *Builder {
 	b := &Builder{
-		entryMap: make(map[string]*entry),
+		entryMap:   make(map[string]*entry),
+		tailoring:  make(map[string][]tailor),
+		settings:   make(map[string]Settings),
+		cldrSource: make(map[string]string),
 	}
 	return b
 }
@@ -120,11 +154,271 @@ func (b *Builder) Add(str []rune, colelems [][]int) error {
 // sorts "ü" after "ue" at the secondary level for German.
 // See http://www.unicode.org/reports/tr10/#Tailoring_Example for details
 // on parametric tailoring.
+//
+// x and y may name a rune, a sequence of runes forming an expansion, or a
+// contraction already known to the Builder or discoverable from the root
+// table.  Tailorings for a locale are remembered in the order they are
+// added; a later rule may use the y of an earlier rule as its reset
+// anchor x, chaining the inserted weights.  Tailorings are not applied
+// until Build is called for locale; they never affect the root table or
+// any other locale.
 func (b *Builder) AddTailoring(locale, x, y string, l collate.Level) error {
-	// TODO: implement.
+	return b.addTailoring(locale, x, y, l, false)
+}
+
+// addTailoring is the shared implementation behind AddTailoring and
+// ParseCLDR's ICU rule interpreter, which additionally needs the
+// CLDR-specific "insert before" form of a reset.
+func (b *Builder) addTailoring(locale, x, y string, l collate.Level, before bool) error {
+	if x == "" || y == "" {
+		return fmt.Errorf("AddTailoring: x and y must be non-empty")
+	}
+	b.tailoring[locale] = append(b.tailoring[locale], tailor{x, y, l, before})
+	return nil
+}
+
+// tailor returns a new Builder that holds a private copy of b's entries with
+// the tailorings registered for locale applied on top.  b itself, and thus
+// the root table and any other locale, is left untouched.
+func (b *Builder) tailor(locale string) (*Builder, error) {
+	nb := &Builder{entryMap: make(map[string]*entry, len(b.entryMap))}
+	for _, e := range b.entry {
+		ne := new(entry)
+		*ne = *e
+		ne.elems = make([][]int, len(e.elems))
+		for i, ce := range e.elems {
+			ne.elems[i] = append([]int(nil), ce...)
+		}
+		nb.entry = append(nb.entry, ne)
+		nb.entryMap[ne.str] = ne
+	}
+	for _, t := range b.tailoring[locale] {
+		if err := nb.insertTailoring(t); err != nil {
+			return nil, fmt.Errorf("locale %s: %v", locale, err)
+		}
+	}
+	return nb, nil
+}
+
+// resolveAnchor returns the entry for s, generating and recording its
+// collation elements, as either a plain rune sequence or a contraction, if
+// it is not yet present.
+func (b *Builder) resolveAnchor(s string) (*entry, error) {
+	if e, ok := b.entryMap[s]; ok {
+		return e, nil
+	}
+	elems := b.genColElems(s)
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("could not resolve reset position %q", s)
+	}
+	e := &entry{runes: []rune(s), str: s, elems: elems}
+	b.entry = append(b.entry, e)
+	b.entryMap[s] = e
+	return e, nil
+}
+
+// insertTailoring inserts t.y into the entry map so that it sorts strictly
+// after t.x (or, if t.before is set, strictly before it) at level t.level
+// and equal to t.x at every more significant level, per the UCA parametric
+// tailoring algorithm (TR10 §3.7).
+func (b *Builder) insertTailoring(t tailor) error {
+	ax, err := b.resolveAnchor(t.x)
+	if err != nil {
+		return err
+	}
+	ace := ax.elems[len(ax.elems)-1]
+	nce := append([]int(nil), ace...)
+	switch {
+	case t.level == collate.Primary && t.before:
+		if p, ok := b.prevPrimary(ace[0]); ok {
+			nce[0], nce[1], nce[2] = p, defaultSecondary, defaultTertiary
+		} else {
+			// The reserved gap before this primary is exhausted; fall back
+			// to differentiating y from x at the secondary level instead,
+			// same as the after-primary case below.
+			nce[1] = b.prevSecondary(ace[0], ace[1])
+			nce[2] = defaultTertiary
+		}
+	case t.level == collate.Primary:
+		if p, ok := b.nextPrimary(ace[0]); ok {
+			nce[0], nce[1], nce[2] = p, defaultSecondary, defaultTertiary
+		} else {
+			// The reserved gap after this primary is exhausted; fall back
+			// to differentiating y from x at the secondary level instead.
+			nce[1] = b.nextSecondary(ace[0], ace[1])
+			nce[2] = defaultTertiary
+		}
+	case t.level == collate.Secondary && t.before:
+		nce[1] = b.prevSecondary(ace[0], ace[1])
+		nce[2] = defaultTertiary
+	case t.level == collate.Secondary:
+		nce[1] = b.nextSecondary(ace[0], ace[1])
+		nce[2] = defaultTertiary
+	case t.level == collate.Tertiary && t.before:
+		nce[2] = b.prevTertiary(ace[0], ace[1], ace[2])
+	case t.level == collate.Tertiary:
+		nce[2] = b.nextTertiary(ace[0], ace[1], ace[2])
+	case t.level == collate.Quaternary:
+		// This table format does not model a separate quaternary weight;
+		// fold quaternary tailorings into the tertiary level, the lowest
+		// level it does distinguish.
+		nce[2] = b.nextTertiary(ace[0], ace[1], ace[2])
+	case t.level == collate.Identity:
+		// Equal at every weighted level; y is ordered by its own runes.
+	default:
+		return fmt.Errorf("unsupported tailoring level %v", t.level)
+	}
+	ay, ok := b.entryMap[t.y]
+	if !ok {
+		ay = &entry{runes: []rune(t.y), str: t.y}
+		b.entry = append(b.entry, ay)
+		b.entryMap[t.y] = ay
+	}
+	ay.elems = [][]int{nce}
+	ay.decompose = false
 	return nil
 }
 
+// sortedPrimaries returns the distinct primary weights used in the entry
+// table, sorted in increasing order.
+func (b *Builder) sortedPrimaries() []int {
+	if b.primaries == nil {
+		seen := make(map[int]bool)
+		for _, e := range b.entry {
+			for _, ce := range e.elems {
+				if !seen[ce[0]] {
+					seen[ce[0]] = true
+					b.primaries = append(b.primaries, ce[0])
+				}
+			}
+		}
+		sort.Ints(b.primaries)
+	}
+	return b.primaries
+}
+
+// primaryGapAfter returns the root primary that owns the reserved gap p
+// draws from when used as a nextPrimary anchor: p itself if p is a root
+// primary, or otherwise the nearest root primary below it. A chained
+// tailoring (AddTailoring anchored on a y from an earlier rule, rather
+// than on a root rune) still allocates out of the same reserved gap as
+// the root primary that gap belongs to, so it must share that gap's
+// owner, not be treated as opening a fresh one of its own.
+func (b *Builder) primaryGapAfter(p int) int {
+	primaries := b.sortedPrimaries()
+	i := sort.SearchInts(primaries, p)
+	if i < len(primaries) && primaries[i] == p {
+		return p
+	}
+	if i == 0 {
+		return p
+	}
+	return primaries[i-1]
+}
+
+// nextPrimary returns an unused primary weight from the gap reserved after
+// p and reports true, or reports false if that gap is exhausted.
+func (b *Builder) nextPrimary(p int) (int, bool) {
+	owner := b.primaryGapAfter(p)
+	primaries := b.sortedPrimaries()
+	i := sort.SearchInts(primaries, owner)
+	limit := owner + primaryGap
+	if i+1 < len(primaries) && primaries[i+1] < limit {
+		limit = primaries[i+1]
+	}
+	if b.primaryUsed == nil {
+		b.primaryUsed = make(map[int]int)
+	}
+	n := owner + 1 + b.primaryUsed[owner]
+	if n >= limit {
+		return 0, false
+	}
+	b.primaryUsed[owner]++
+	return n, true
+}
+
+// primaryGapBefore returns the root primary that owns the reserved gap p
+// draws from when used as a prevPrimary anchor: p itself if p is a root
+// primary, or otherwise the nearest root primary above it. See
+// primaryGapAfter.
+func (b *Builder) primaryGapBefore(p int) int {
+	primaries := b.sortedPrimaries()
+	i := sort.SearchInts(primaries, p)
+	if i == len(primaries) {
+		return p
+	}
+	return primaries[i]
+}
+
+// prevPrimary returns an unused primary weight from the gap reserved before
+// p and reports true, or reports false if that gap is exhausted.  It backs
+// the CLDR "[before 1]" reset.
+func (b *Builder) prevPrimary(p int) (int, bool) {
+	owner := b.primaryGapBefore(p)
+	primaries := b.sortedPrimaries()
+	i := sort.SearchInts(primaries, owner)
+	floor := owner - primaryGap
+	if i > 0 && primaries[i-1] > floor {
+		floor = primaries[i-1]
+	}
+	if b.primaryUsed == nil {
+		b.primaryUsed = make(map[int]int)
+	}
+	key := -owner // negative of owner, so "before" shares neither counter nor gap with "after"
+	n := owner - 1 - b.primaryUsed[key]
+	if n <= floor {
+		return 0, false
+	}
+	b.primaryUsed[key]++
+	return n, true
+}
+
+// nextSecondary returns the next unused secondary weight for runes sharing
+// primary weight p and secondary weight s.
+func (b *Builder) nextSecondary(p, s int) int {
+	if b.secondaryUsed == nil {
+		b.secondaryUsed = make(map[[2]int]int)
+	}
+	key := [2]int{p, s}
+	b.secondaryUsed[key]++
+	return s + b.secondaryUsed[key]
+}
+
+// prevSecondary returns the next unused secondary weight below s for runes
+// sharing primary weight p and secondary weight s.  It backs the CLDR
+// "[before 2]" reset.
+func (b *Builder) prevSecondary(p, s int) int {
+	if b.secondaryUsed == nil {
+		b.secondaryUsed = make(map[[2]int]int)
+	}
+	key := [2]int{-p - 1, s} // distinct key space from nextSecondary's (p, s)
+	b.secondaryUsed[key]++
+	return s - b.secondaryUsed[key]
+}
+
+// nextTertiary returns the next unused tertiary weight for runes sharing
+// primary weight p, secondary weight s and tertiary weight t.
+func (b *Builder) nextTertiary(p, s, t int) int {
+	if b.tertiaryUsed == nil {
+		b.tertiaryUsed = make(map[[3]int]int)
+	}
+	key := [3]int{p, s, t}
+	b.tertiaryUsed[key]++
+	return t + b.tertiaryUsed[key]
+}
+
+// prevTertiary returns the next unused tertiary weight below t for runes
+// sharing primary weight p, secondary weight s and tertiary weight t.  It
+// backs the CLDR "[before 3]" reset.
+func (b *Builder) prevTertiary(p, s, t int) int {
+	if b.tertiaryUsed == nil {
+		b.tertiaryUsed = make(map[[3]int]int)
+	}
+	key := [3]int{-p - 1, s, t} // distinct key space from nextTertiary's (p, s, t)
+	b.tertiaryUsed[key]++
+	return t - b.tertiaryUsed[key]
+}
+
 func (b *Builder) baseColElem(e *entry) uint32 {
 	ce := uint32(0)
 	var err error
@@ -177,14 +471,29 @@ func (b *Builder) error(e error) {
 	}
 }
 
-func (b *Builder) build() (*table, error) {
+// finish runs the build pipeline over b's current entries and returns the
+// resulting table.  It mutates b's entries in place (normalizing weights,
+// recording expansion and contraction indices), which is what allows
+// diffOverlay to later compare a locale Builder's finished entries against
+// the root's.
+//
+// root is nil when b is building the root table itself. When b is instead
+// tailoring root (b came from root.tailor), root's already-finished Builder
+// is passed through to processExpansions/processContractions so that the
+// expansion and contraction data they generate is a genuine append-only
+// extension of root's: entries whose CE run root already has keep root's
+// exact offset, and only CE runs root doesn't have are appended after it.
+// Without this, both tables are built independently from scratch and their
+// only connection is incidentally sharing CE run content, which diffOverlay
+// cannot tell apart from root's data having been relocated.
+func (b *Builder) finish(root *Builder) (*table, error) {
 	b.t = &table{}
 
 	b.contractCJK()
-	b.simplify()            // requires contractCJK
-	b.processExpansions()   // requires simplify
-	b.processContractions() // requires simplify
-	b.buildTrie()           // requires process*
+	b.simplify()                 // requires contractCJK
+	b.processExpansions(root)    // requires simplify
+	b.processContractions(root) // requires simplify
+	b.buildTrie()                // requires process*
 
 	if b.err != nil {
 		return nil, b.err
@@ -192,28 +501,194 @@ func (b *Builder) build() (*table, error) {
 	return b.t, nil
 }
 
-// Build builds a Collator for the given locale.  To build the root table, set locale to "".
+// root returns the table for the root locale, building and caching it on
+// first use.
+func (b *Builder) root() (*table, error) {
+	if b.rootTable == nil {
+		t, err := b.finish(nil)
+		if err != nil {
+			return nil, err
+		}
+		b.rootTable = t
+	}
+	return b.rootTable, nil
+}
+
+// Overlay holds the part of a tailored table that differs from the root
+// table it was derived from: the collation elements of starter runes whose
+// weights a tailoring patched or added, plus any expansion and contraction
+// rows a tailoring appended.  collate.Init combines a root table with an
+// Overlay to build a Collator for a tailored locale without duplicating the
+// (typically much larger) parts of the table tailoring left untouched.
+type Overlay struct {
+	Locale       string
+	Index        map[rune]uint32
+	ExpandCE     []uint32
+	ExpandIndex  []uint16
+	ExpandLen    []uint8
+	ContractElem []uint32
+}
+
+// Lookup implements collate.Weights for the delta a tailoring adds on top
+// of its root table: it reports the patched or newly added collation
+// element for r, if the tailoring touched r at all.
+func (ov *Overlay) Lookup(r rune) (ce uint32, found bool) {
+	ce, found = ov.Index[r]
+	return ce, found
+}
+
+// print writes ov as a Go source variable declaration named name to w,
+// mirroring table.print. It returns the number of bytes written.
+func (ov *Overlay) print(w io.Writer, name string) (int, error) {
+	return fmt.Fprintf(w, "var %s = Overlay{\n\tLocale: %q,\n\tIndex: %#v,\n\tExpandCE: %#v,\n\tExpandIndex: %#v,\n\tExpandLen: %#v,\n\tContractElem: %#v,\n}\n\n",
+		name, ov.Locale, ov.Index, ov.ExpandCE, ov.ExpandIndex, ov.ExpandLen, ov.ContractElem)
+}
+
+// diffOverlay computes the Overlay that, applied to b's root table,
+// reproduces nb's table full.  b and nb must both have already been
+// finished (via root and tailor+finish, respectively).
+func (b *Builder) diffOverlay(locale string, nb *Builder, full *table) (*Overlay, error) {
+	root, err := b.root()
+	if err != nil {
+		return nil, err
+	}
+	ov := &Overlay{Locale: locale, Index: make(map[rune]uint32)}
+	for _, ne := range nb.entry {
+		if ne.skip() || len(ne.runes) != 1 {
+			continue // contractions are captured via ContractElem below
+		}
+		ce := nb.colElem(ne)
+		if re, ok := b.entryMap[ne.str]; ok && !re.skip() && b.colElem(re) == ce {
+			continue
+		}
+		ov.Index[ne.runes[0]] = ce
+	}
+	if len(full.expandIndex) > len(root.expandIndex) {
+		ov.ExpandIndex = append(ov.ExpandIndex, full.expandIndex[len(root.expandIndex):]...)
+		ov.ExpandLen = append(ov.ExpandLen, full.expandLen[len(root.expandIndex):]...)
+	}
+	if len(full.expandCE) > len(root.expandCE) {
+		ov.ExpandCE = append(ov.ExpandCE, full.expandCE[len(root.expandCE):]...)
+	}
+	if len(full.contractElem) > len(root.contractElem) {
+		ov.ContractElem = append(ov.ContractElem, full.contractElem[len(root.contractElem):]...)
+	}
+	return ov, nil
+}
+
+// Locales returns the locales for which a tailoring has been registered
+// through AddTailoring, sorted alphabetically.
+func (b *Builder) Locales() []string {
+	locales := make([]string, 0, len(b.tailoring))
+	for locale := range b.tailoring {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Build builds a Collator for the given locale.  To build the root table,
+// set locale to "".  The returned Collator shares the root table's data
+// with any other locale built from b; only the, typically small, per-locale
+// overlay computed by diffOverlay is specific to locale.
 func (b *Builder) Build(locale string) (*collate.Collator, error) {
-	t, err := b.build()
+	root, err := b.root()
+	if err != nil {
+		return nil, err
+	}
+	if locale == "" {
+		return collate.Init(root), nil
+	}
+	nb, err := b.tailor(locale)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: support multiple locales
-	return collate.Init(t), nil
+	full, err := nb.finish(b)
+	if err != nil {
+		return nil, err
+	}
+	ov, err := b.diffOverlay(locale, nb, full)
+	if err != nil {
+		return nil, err
+	}
+	return collate.Init(root, ov), nil
 }
 
-// Print prints all tables to a Go file that can be included in
-// the Collate package.
+// Print prints the root table, plus an Overlay for every locale registered
+// through AddTailoring, to a single Go file that can be included in the
+// Collate package.  Each locale's Overlay holds only the data diffOverlay
+// found patched or added relative to the root table, the same delta Build
+// would hand to collate.Init, rather than a second copy of the locale's
+// full (and, for any realistic locale set, much larger) table.  Output is
+// deterministic: locales are printed in sorted order and the resulting
+// map[string]*Overlay is built in the same order.
 func (b *Builder) Print(w io.Writer) (int, error) {
-	t, err := b.build()
+	root, err := b.root()
 	if err != nil {
 		return 0, err
 	}
-	// TODO: support multiple locales
-	n, _, err := t.print(w, "root")
+	n, _, err := root.print(w, "root")
+	if err != nil {
+		return n, err
+	}
+	locales := b.Locales()
+	names := make([]string, len(locales))
+	for i, locale := range locales {
+		nb, err := b.tailor(locale)
+		if err != nil {
+			return n, err
+		}
+		full, err := nb.finish(b)
+		if err != nil {
+			return n, err
+		}
+		ov, err := b.diffOverlay(locale, nb, full)
+		if err != nil {
+			return n, err
+		}
+		names[i] = "tailor" + identifier(locale)
+		m, err := ov.print(w, names[i])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	m, err := fmt.Fprint(w, "\nvar locales = map[string]*Overlay{\n")
+	n += m
+	if err != nil {
+		return n, err
+	}
+	for i, locale := range locales {
+		m, err = fmt.Fprintf(w, "\t%q: &%s,\n", locale, names[i])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	m, err = fmt.Fprint(w, "}\n")
+	n += m
 	return n, err
 }
 
+// identifier turns a locale string such as "en-US" into a Go identifier
+// fragment such as "EnUS".
+func identifier(locale string) string {
+	var buf []byte
+	upper := true
+	for _, r := range locale {
+		if r == '-' || r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf = append(buf, string(r)...)
+	}
+	return string(buf)
+}
+
 // reproducibleFromNFKD checks whether the given expansion could be generated
 // from an NFKD expansion.
 func reproducibleFromNFKD(e *entry, exp, nfkd [][]int) bool {
@@ -369,29 +844,83 @@ func (b *Builder) contractCJK() {
 	}
 }
 
-// appendExpansion converts the given collation sequence to
-// collation elements and adds them to the expansion table.
-// It returns an index to the expansion table.
+// expandKey returns the dedup key appendExpansion and processExpansions'
+// root-seeding both use to recognize identical CE runs, so a tailored
+// table's pool agrees with root's on what counts as "the same run".
+func expandKey(ces []uint32) string {
+	return fmt.Sprintf("%v", ces)
+}
+
+// appendExpansion converts the given collation sequence to collation
+// elements and adds a run for them to the expansion tables. It returns
+// an index into t.expandIndex/t.expandLen identifying the new run.
+//
+// This used to append a length word followed by a fresh copy of every CE
+// directly to expandElem, which on the full DUCET made expandElem by far
+// the largest generated table. t.expandCE now pools CE runs instead: an
+// entry whose encoded CEs are identical to an already-added run reuses
+// that run's offset rather than appending a new copy, and the run's
+// length lives in the parallel t.expandLen array instead of being
+// repeated inline for every entry that happens to share it.
 func (b *Builder) appendExpansion(e *entry) int {
 	t := b.t
-	i := len(t.expandElem)
-	ce := uint32(len(e.elems))
-	t.expandElem = append(t.expandElem, ce)
-	for _, w := range e.elems {
+	ces := make([]uint32, len(e.elems))
+	for j, w := range e.elems {
 		ce, err := makeCE(w)
 		if err != nil {
 			b.error(err)
 			return -1
 		}
-		t.expandElem = append(t.expandElem, ce)
+		ces[j] = ce
+	}
+	if b.expandCEIndex == nil {
+		b.expandCEIndex = make(map[string]uint16)
+	}
+	key := expandKey(ces)
+	off, ok := b.expandCEIndex[key]
+	if !ok {
+		off = uint16(len(t.expandCE))
+		t.expandCE = append(t.expandCE, ces...)
+		b.expandCEIndex[key] = off
 	}
+	i := len(t.expandIndex)
+	t.expandIndex = append(t.expandIndex, off)
+	t.expandLen = append(t.expandLen, uint8(len(ces)))
 	return i
 }
 
-// processExpansions extracts data necessary to generate
-// the extraction tables.
-func (b *Builder) processExpansions() {
+// processExpansions extracts data necessary to generate the extraction
+// tables.
+//
+// If root is non-nil, b is tailoring root: the CE-run pool is seeded with
+// root's own t.expandCE, keyed the same way appendExpansion keys it, so
+// that any entry b processes whose CEs are identical to one of root's
+// reuses root's exact offset instead of the two tables coincidentally
+// picking different offsets for the same content. Likewise expandIndex and
+// expandLen start as copies of root's, and an entry whose collation
+// elements equal those of one of root's expansions reuses that expansion's
+// index. Only CE runs that don't already exist in root get appended past
+// the end of the seeded pool, which keeps full.expandCE[:len(root.expandCE)]
+// byte-identical to root and makes full.expandIndex/full.expandCE[len(root...):]
+// a true append-only tail that diffOverlay can hand to the Overlay as-is.
+func (b *Builder) processExpansions(root *Builder) {
 	eidx := make(map[string]int)
+	if root != nil {
+		rt := root.t
+		b.t.expandCE = append([]uint32(nil), rt.expandCE...)
+		b.t.expandIndex = append([]uint16(nil), rt.expandIndex...)
+		b.t.expandLen = append([]uint8(nil), rt.expandLen...)
+		b.expandCEIndex = make(map[string]uint16, len(rt.expandIndex))
+		for i, off := range rt.expandIndex {
+			n := uint16(rt.expandLen[i])
+			b.expandCEIndex[expandKey(rt.expandCE[off:off+n])] = off
+		}
+		for _, e := range root.entry {
+			if e.expansion() {
+				eidx[fmt.Sprintf("%v", e.elems)] = e.expansionIndex
+			}
+		}
+	}
 	for _, e := range b.entry {
 		if !e.expansion() {
 			continue
@@ -406,7 +935,37 @@ func (b *Builder) processExpansions() {
 	}
 }
 
-func (b *Builder) processContractions() {
+// contractBlockEqual reports whether elems[idx:idx+len(ces)] exists and
+// equals ces, i.e. whether a starter's about-to-be-written contraction
+// block is already present, unchanged, at idx.
+func contractBlockEqual(elems []uint32, idx int, ces []uint32) bool {
+	if idx < 0 || idx+len(ces) > len(elems) {
+		return false
+	}
+	for i, v := range ces {
+		if elems[idx+i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// processContractions builds the contraction tries and collation elements
+// for every starter rune that begins a contraction.
+//
+// If root is non-nil, b is tailoring root. Rebuilding every starter's
+// block from scratch the way a from-scratch table does would be wrong
+// here: a tailoring that adds one new suffix under a starter root already
+// contracts on grows that starter's block, which would shift every later
+// starter's block to a new offset even though nothing about them changed.
+// To keep offsets stable across root and a tailoring, b starts from a
+// copy of root's own contraction data and, for each starter, reuses
+// root's offset whenever the block it computes for that starter is
+// byte-identical to what's already there; only a starter whose block is
+// new or actually changed gets appended after root's data. That makes
+// full.contractElem[len(root.contractElem):] a true append-only tail,
+// the same invariant processExpansions relies on for expandCE.
+func (b *Builder) processContractions(root *Builder) {
 	// Collate contractions per starter rune.
 	starters := []rune{}
 	cm := make(map[rune][]*entry)
@@ -434,6 +993,15 @@ func (b *Builder) processContractions() {
 	// Build the tries for the contractions.
 	t := b.t
 	handlemap := make(map[string]ctHandle)
+	var rt *table
+	if root != nil {
+		rt = root.t
+		t.contractElem = append([]uint32(nil), rt.contractElem...)
+		t.contractTries.sets = append([][]string(nil), rt.contractTries.sets...)
+		for i, sufx := range rt.contractTries.sets {
+			handlemap[strings.Join(sufx, "\n")] = ctHandle{n: i}
+		}
+	}
 	for _, r := range starters {
 		l := cm[r]
 		// Compute suffix strings. There are 31 different contraction suffix
@@ -480,13 +1048,24 @@ func (b *Builder) processContractions() {
 			}
 			es[o] = e
 		}
+		// Collation elements for the contractions, in bucket order.
+		ces := make([]uint32, len(es))
+		for i, e := range es {
+			ces[i] = b.baseColElem(e)
+		}
+		if root != nil {
+			if re, ok := root.entryMap[string(r)]; ok && re.contractionStarter() &&
+				contractBlockEqual(rt.contractElem, re.contractionIndex, ces) {
+				es[0].contractionIndex = re.contractionIndex
+				es[0].contractionHandle = handle
+				continue
+			}
+		}
 		// Store info in entry for starter rune.
 		es[0].contractionIndex = len(t.contractElem)
 		es[0].contractionHandle = handle
 		// Add collation elements for contractions.
-		for _, e := range es {
-			t.contractElem = append(t.contractElem, b.baseColElem(e))
-		}
+		t.contractElem = append(t.contractElem, ces...)
 	}
 }
 
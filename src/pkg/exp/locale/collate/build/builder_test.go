@@ -0,0 +1,136 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"exp/locale/collate"
+	"testing"
+)
+
+// newTestBuilder returns a Builder whose sortedPrimaries are exactly ps,
+// without going through Add/finish, so each test controls the root
+// primaries directly.
+func newTestBuilder(ps ...int) *Builder {
+	b := NewBuilder()
+	b.primaries = append([]int(nil), ps...)
+	return b
+}
+
+func TestNextPrimaryGapBoundary(t *testing.T) {
+	// Root primaries 10 and 20: the gap after 10 is [11, 14) per primaryGap,
+	// which ends before the next root primary at 20, so only 11, 12, 13 are
+	// free.
+	b := newTestBuilder(10, 20)
+	for _, want := range []int{11, 12, 13} {
+		got, ok := b.nextPrimary(10)
+		if !ok || got != want {
+			t.Fatalf("nextPrimary(10) = %d, %v; want %d, true", got, ok, want)
+		}
+	}
+	if _, ok := b.nextPrimary(10); ok {
+		t.Fatalf("nextPrimary(10) succeeded after the gap should be exhausted")
+	}
+}
+
+func TestNextPrimaryAdjacentRoots(t *testing.T) {
+	// Root primaries 10 and 11 are adjacent: there is no room after 10 at
+	// all, regardless of primaryGap.
+	b := newTestBuilder(10, 11)
+	if _, ok := b.nextPrimary(10); ok {
+		t.Fatalf("nextPrimary(10) succeeded with no gap before the next root primary")
+	}
+}
+
+func TestPrevPrimaryGapBoundary(t *testing.T) {
+	// Mirror of TestNextPrimaryGapBoundary: the gap before 20 is (16, 20) per
+	// primaryGap, which starts after the root primary at 10, leaving 19, 18,
+	// 17 free.
+	b := newTestBuilder(10, 20)
+	for _, want := range []int{19, 18, 17} {
+		got, ok := b.prevPrimary(20)
+		if !ok || got != want {
+			t.Fatalf("prevPrimary(20) = %d, %v; want %d, true", got, ok, want)
+		}
+	}
+	if _, ok := b.prevPrimary(20); ok {
+		t.Fatalf("prevPrimary(20) succeeded after the gap should be exhausted")
+	}
+}
+
+func TestPrevPrimaryAdjacentRoots(t *testing.T) {
+	b := newTestBuilder(10, 11)
+	if _, ok := b.prevPrimary(11); ok {
+		t.Fatalf("prevPrimary(11) succeeded with no gap before it")
+	}
+}
+
+// newAnchoredBuilder returns a Builder with a single entry "x" with
+// collation elements fixed at p, s, t, and sortedPrimaries seeded (in
+// ascending order, as sortedPrimaries requires) so the gap around p is
+// already exhausted, forcing insertTailoring's fallback branches.
+func newAnchoredBuilder(p, s, t int, primaries ...int) *Builder {
+	b := NewBuilder()
+	b.Add([]rune("x"), [][]int{{p, s, t}})
+	b.primaries = primaries
+	return b
+}
+
+func TestNextPrimarySharesGapAcrossChainedAnchors(t *testing.T) {
+	// Root primaries 10 and 20, so the gap after 10 is [11, 14). A direct
+	// reset off the root (10) and a reset chained off a value already
+	// allocated from that same gap (11) must draw from one shared pool:
+	// each call, regardless of which anchor it names, must return a value
+	// no earlier call (from either anchor) has already handed out.
+	b := newTestBuilder(10, 20)
+	y1, ok := b.nextPrimary(10)
+	if !ok || y1 != 11 {
+		t.Fatalf("nextPrimary(10) = %d, %v; want 11, true", y1, ok)
+	}
+	y2, ok := b.nextPrimary(y1)
+	if !ok || y2 != 12 {
+		t.Fatalf("nextPrimary(%d) = %d, %v; want 12, true", y1, y2, ok)
+	}
+	y3, ok := b.nextPrimary(10)
+	if !ok || y3 != 13 {
+		t.Fatalf("nextPrimary(10) = %d, %v; want 13, true", y3, ok)
+	}
+	if y2 == y3 {
+		t.Fatalf("nextPrimary(10) returned %d, colliding with the chained nextPrimary(%d) = %d", y3, y1, y2)
+	}
+}
+
+func TestInsertTailoringAfterPrimaryFallsBackToSecondary(t *testing.T) {
+	// p and the following root primary adjacent: nextPrimary(p) has no
+	// room, so the after-primary branch must fall back to nextSecondary.
+	b := newAnchoredBuilder(10, defaultSecondary, defaultTertiary, 10, 11)
+	if err := b.insertTailoring(tailor{x: "x", y: "y", level: collate.Primary}); err != nil {
+		t.Fatal(err)
+	}
+	y := b.entryMap["y"]
+	nce := y.elems[0]
+	if nce[0] != 10 {
+		t.Fatalf("primary = %d; want unchanged at 10", nce[0])
+	}
+	if nce[1] != defaultSecondary+1 {
+		t.Fatalf("secondary = %d; want %d", nce[1], defaultSecondary+1)
+	}
+}
+
+func TestInsertTailoringBeforePrimaryFallsBackToSecondary(t *testing.T) {
+	// p and the preceding root primary adjacent: prevPrimary(p) has no room,
+	// so the before-primary branch must fall back to prevSecondary.
+	b := newAnchoredBuilder(11, defaultSecondary, defaultTertiary, 10, 11)
+	if err := b.insertTailoring(tailor{x: "x", y: "y", level: collate.Primary, before: true}); err != nil {
+		t.Fatal(err)
+	}
+	y := b.entryMap["y"]
+	nce := y.elems[0]
+	if nce[0] != 11 {
+		t.Fatalf("primary = %d; want unchanged at 11", nce[0])
+	}
+	if nce[1] != defaultSecondary-1 {
+		t.Fatalf("secondary = %d; want %d", nce[1], defaultSecondary-1)
+	}
+}
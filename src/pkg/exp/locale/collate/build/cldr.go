@@ -0,0 +1,393 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/xml"
+	"exp/locale/collate"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Settings holds the per-locale collation settings found in a CLDR
+// <collation> element's <settings>.  In a zero Settings, Strength is
+// collate.Identity (the zero Level), Alternate and CaseFirst are
+// unspecified and all flags are off.  ParseCLDR sets Strength to
+// collate.Tertiary when <settings> names no strength.
+type Settings struct {
+	Strength  collate.Level
+	Alternate string // "non-ignorable", "shifted" or "" (unspecified)
+	CaseLevel bool
+	CaseFirst string // "upper", "lower" or "" (unspecified)
+	Numeric   bool
+	Backwards bool
+}
+
+// Settings returns the settings parsed for locale by a prior call to
+// ParseCLDR, or the zero Settings if none were parsed.
+func (b *Builder) Settings(locale string) Settings {
+	return b.settings[locale]
+}
+
+// cldrCollation is the subset of a CLDR <collation> element ParseCLDR uses.
+// CLDR allows the tailoring rules to be given either as a single ICU-syntax
+// string in <cr> (the common case for data converted from ICU) or spelled
+// out structurally in <rules>, which, for our purposes, also carries its
+// text content as an ICU-syntax string.
+type cldrCollation struct {
+	XMLName  xml.Name `xml:"collation"`
+	Settings struct {
+		Strength  string `xml:"strength,attr"`
+		Alternate string `xml:"alternate,attr"`
+		CaseLevel string `xml:"caseLevel,attr"`
+		CaseFirst string `xml:"caseFirst,attr"`
+		Numeric   string `xml:"numeric,attr"`
+		Backwards string `xml:"backwards,attr"`
+	} `xml:"settings"`
+	CR    string `xml:"cr"`
+	Rules string `xml:"rules"`
+}
+
+// ParseCLDR reads a CLDR <collation> element from r and turns its tailoring
+// rules into AddTailoring calls for locale, and its <settings> into a
+// Settings value retrievable through Settings(locale).  This lets callers
+// feed unmodified CLDR collation data into a Builder instead of hand-coding
+// Add and AddTailoring calls.
+func (b *Builder) ParseCLDR(r io.Reader, locale string) error {
+	var c cldrCollation
+	if err := xml.NewDecoder(r).Decode(&c); err != nil {
+		return fmt.Errorf("cldr: %v", err)
+	}
+	rules := strings.TrimSpace(c.CR)
+	if rules == "" {
+		rules = strings.TrimSpace(c.Rules)
+	}
+	b.cldrSource[locale] = rules
+	b.settings[locale] = Settings{
+		Strength:  parseStrength(c.Settings.Strength),
+		Alternate: c.Settings.Alternate,
+		CaseLevel: c.Settings.CaseLevel == "on",
+		CaseFirst: c.Settings.CaseFirst,
+		Numeric:   c.Settings.Numeric == "on",
+		Backwards: c.Settings.Backwards == "on",
+	}
+	if rules == "" {
+		return nil
+	}
+	p := &icuParser{b: b, locale: locale, s: rules}
+	if err := p.parse(); err != nil {
+		return fmt.Errorf("cldr: locale %s: %v", locale, err)
+	}
+	return nil
+}
+
+func parseStrength(s string) collate.Level {
+	switch s {
+	case "primary":
+		return collate.Primary
+	case "secondary":
+		return collate.Secondary
+	case "quaternary":
+		return collate.Quaternary
+	case "identical":
+		return collate.Identity
+	default:
+		return collate.Tertiary
+	}
+}
+
+// logicalResets maps the CLDR/ICU logical reset positions this parser
+// understands to a rune whose root collation elements approximate the
+// described position.  These are approximations: the DUCET does not expose
+// "first/last ignorable" positions as addressable constants, so we anchor
+// to a representative rune from the corresponding category instead.
+var logicalResets = map[string]rune{
+	"first tertiary ignorable":  0x0000,
+	"last tertiary ignorable":   0x0000,
+	"first secondary ignorable": 0x0000,
+	"last secondary ignorable":  0x0000,
+	"first primary ignorable":   0x0332, // COMBINING LOW LINE
+	"last primary ignorable":    0x0332,
+	"first variable":            0x0020, // SPACE
+	"last variable":             0x002f, // SOLIDUS
+	"first non ignorable":       0x0021, // EXCLAMATION MARK
+	"last non ignorable":        0xfffd, // REPLACEMENT CHARACTER
+}
+
+// icuParser interprets an ICU collation rule string, of the kind found in a
+// CLDR <cr>/<rules> element, as a sequence of resets and relations and
+// issues the corresponding tailorings on b for locale.
+//
+// The grammar handled is, informally:
+//
+//	rules    = (reset relation*)*
+//	reset    = '&' ('[' "before" ws digit ']')? anchor
+//	         | '[' "import" ws locale ']'
+//	relation = ('<' | '<<' | '<<<' | '<<<<' | '=') element
+//	anchor   = element
+//	element  = literal | '[' logical-position ']'
+//	literal  = quoted or bare rune sequence, optionally followed by
+//	           a '|' prefix context or a '/' extension, both of which
+//	           are parsed but, as this builder has no notion of context
+//	           sensitive tailoring, only their primary element is kept.
+type icuParser struct {
+	b      *Builder
+	locale string
+	s      string
+	i      int
+}
+
+func (p *icuParser) parse() error {
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return nil
+		}
+		switch p.s[p.i] {
+		case '&':
+			p.i++
+			if err := p.parseResetAndRelations(); err != nil {
+				return err
+			}
+		case '[':
+			if err := p.parseImport(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("expected '&' or '[import ...]' at offset %d", p.i)
+		}
+	}
+}
+
+func (p *icuParser) parseImport() error {
+	directive, err := p.readBracket()
+	if err != nil {
+		return err
+	}
+	const prefix = "import "
+	if !strings.HasPrefix(directive, prefix) {
+		return fmt.Errorf("unsupported directive [%s]", directive)
+	}
+	loc := strings.TrimSpace(directive[len(prefix):])
+	src, ok := p.b.cldrSource[loc]
+	if !ok {
+		return fmt.Errorf("import of locale %q before it was parsed", loc)
+	}
+	sub := &icuParser{b: p.b, locale: p.locale, s: src}
+	if err := sub.parse(); err != nil {
+		return fmt.Errorf("import %s: %v", loc, err)
+	}
+	return nil
+}
+
+func (p *icuParser) parseResetAndRelations() error {
+	before := 0
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == '[' {
+		mark := p.i
+		directive, err := p.readBracket()
+		if err != nil {
+			return err
+		}
+		if n, ok := parseBefore(directive); ok {
+			before = n
+		} else {
+			p.i = mark // not a [before N]; re-read as the anchor element below
+		}
+	}
+	x, err := p.readElement()
+	if err != nil {
+		return err
+	}
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) || p.s[p.i] == '&' || p.s[p.i] == '[' {
+			return nil
+		}
+		level, err := p.readRelation()
+		if err != nil {
+			return err
+		}
+		y, err := p.readElement()
+		if err != nil {
+			return err
+		}
+		wantBefore := before != 0 && levelNumber(level) == before
+		if err := p.b.addTailoring(p.locale, x, y, level, wantBefore); err != nil {
+			return err
+		}
+		// Only the first relation after a reset honors [before N]; resets
+		// chain normally after that, as TR35 specifies.
+		before = 0
+		x = y
+	}
+}
+
+func parseBefore(directive string) (int, bool) {
+	const prefix = "before "
+	if !strings.HasPrefix(directive, prefix) {
+		return 0, false
+	}
+	switch strings.TrimSpace(directive[len(prefix):]) {
+	case "1":
+		return 1, true
+	case "2":
+		return 2, true
+	case "3":
+		return 3, true
+	}
+	return 0, false
+}
+
+func levelNumber(l collate.Level) int {
+	switch l {
+	case collate.Primary:
+		return 1
+	case collate.Secondary:
+		return 2
+	case collate.Tertiary:
+		return 3
+	}
+	return 0
+}
+
+func (p *icuParser) readRelation() (collate.Level, error) {
+	rest := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, "<<<<"):
+		p.i += 4
+		return collate.Quaternary, nil
+	case strings.HasPrefix(rest, "<<<"):
+		p.i += 3
+		return collate.Tertiary, nil
+	case strings.HasPrefix(rest, "<<"):
+		p.i += 2
+		return collate.Secondary, nil
+	case strings.HasPrefix(rest, "<"):
+		p.i++
+		return collate.Primary, nil
+	case strings.HasPrefix(rest, "="):
+		p.i++
+		return collate.Identity, nil
+	}
+	return 0, fmt.Errorf("expected a relation operator at offset %d", p.i)
+}
+
+// readElement reads a single reset anchor or relation target: a logical
+// position, or a literal rune sequence optionally followed by a '|' prefix
+// context or a '/' extension.  Only the literal itself is returned; the
+// context and extension are consumed but not otherwise acted upon, as this
+// builder only tailors context-free relations.
+func (p *icuParser) readElement() (string, error) {
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return "", fmt.Errorf("unexpected end of rules, expected an element")
+	}
+	var lit string
+	if p.s[p.i] == '[' {
+		name, err := p.readBracket()
+		if err != nil {
+			return "", err
+		}
+		r, ok := logicalResets[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported logical position [%s]", name)
+		}
+		lit = string(r)
+	} else {
+		var err error
+		lit, err = p.readLiteral()
+		if err != nil {
+			return "", err
+		}
+	}
+	p.skipSpace()
+	if p.i < len(p.s) && (p.s[p.i] == '|' || p.s[p.i] == '/') {
+		p.i++
+		if _, err := p.readLiteral(); err != nil {
+			return "", err
+		}
+	}
+	return lit, nil
+}
+
+// readLiteral reads a bare or quoted rune sequence, stopping at whitespace
+// or an unescaped relation, reset, prefix or extension operator.
+func (p *icuParser) readLiteral() (string, error) {
+	var sb bytes.Buffer
+	read := false
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '\'':
+			p.i++
+			start := p.i
+			for p.i < len(p.s) && p.s[p.i] != '\'' {
+				p.i++
+			}
+			if p.i >= len(p.s) {
+				return "", fmt.Errorf("unterminated quoted literal")
+			}
+			sb.WriteString(p.s[start:p.i])
+			p.i++
+			read = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if read {
+				return sb.String(), nil
+			}
+			p.i++
+		case c == '&' || c == '<' || c == '=' || c == '[' || c == '|' || c == '/':
+			if !read {
+				return "", fmt.Errorf("expected an element at offset %d", p.i)
+			}
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+			p.i++
+			read = true
+		}
+	}
+	if !read {
+		return "", fmt.Errorf("unexpected end of rules, expected an element")
+	}
+	return sb.String(), nil
+}
+
+// readBracket reads a '[' ... ']' directive and returns its trimmed
+// contents without the brackets.
+func (p *icuParser) readBracket() (string, error) {
+	if p.s[p.i] != '[' {
+		return "", fmt.Errorf("expected '[' at offset %d", p.i)
+	}
+	start := p.i + 1
+	depth := 1
+	for p.i = start; p.i < len(p.s); p.i++ {
+		switch p.s[p.i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				s := strings.TrimSpace(p.s[start:p.i])
+				p.i++
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unterminated '[' starting at offset %d", start)
+}
+
+func (p *icuParser) skipSpace() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"exp/locale/collate"
+	"strings"
+	"testing"
+)
+
+func TestParseCLDRSimpleChain(t *testing.T) {
+	const xmlData = `<collation>
+		<settings strength="primary"/>
+		<cr>&amp;z &lt; &#228; &lt;&lt; &#246;</cr>
+	</collation>`
+	b := NewBuilder()
+	if err := b.ParseCLDR(strings.NewReader(xmlData), "se"); err != nil {
+		t.Fatal(err)
+	}
+	want := []tailor{
+		{x: "z", y: "ä", level: collate.Primary},
+		{x: "ä", y: "ö", level: collate.Secondary},
+	}
+	got := b.tailoring["se"]
+	if len(got) != len(want) {
+		t.Fatalf("got %d tailorings; want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("tailoring %d = %+v; want %+v", i, got[i], w)
+		}
+	}
+	if s := b.Settings("se"); s.Strength != collate.Primary {
+		t.Errorf("Strength = %v; want Primary", s.Strength)
+	}
+}
+
+func TestParseCLDRBeforePrimary(t *testing.T) {
+	const xmlData = `<collation>
+		<cr>&amp;[before 1] a &lt; &#229;</cr>
+	</collation>`
+	b := NewBuilder()
+	if err := b.ParseCLDR(strings.NewReader(xmlData), "da"); err != nil {
+		t.Fatal(err)
+	}
+	want := tailor{x: "a", y: "å", level: collate.Primary, before: true}
+	got := b.tailoring["da"]
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("tailoring = %+v; want [%+v]", got, want)
+	}
+}
+
+func TestParseCLDRImport(t *testing.T) {
+	b := NewBuilder()
+	if err := b.ParseCLDR(strings.NewReader(`<collation><cr>&amp;z &lt; &#228;</cr></collation>`), "root-ish"); err != nil {
+		t.Fatal(err)
+	}
+	const xmlData = `<collation>
+		<cr>[import root-ish]&amp;&#228; &lt; &#229;</cr>
+	</collation>`
+	if err := b.ParseCLDR(strings.NewReader(xmlData), "se"); err != nil {
+		t.Fatal(err)
+	}
+	want := []tailor{
+		{x: "z", y: "ä", level: collate.Primary},
+		{x: "ä", y: "å", level: collate.Primary},
+	}
+	got := b.tailoring["se"]
+	if len(got) != len(want) {
+		t.Fatalf("got %d tailorings; want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("tailoring %d = %+v; want %+v", i, got[i], w)
+		}
+	}
+}
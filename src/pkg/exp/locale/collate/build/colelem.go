@@ -0,0 +1,134 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import "fmt"
+
+// A collation element is packed into a uint32 so that the generated trie and
+// side tables stay compact. Bit 31 distinguishes the two kinds of element a
+// table entry can hold:
+//
+//   - A weight CE (bit 31 == 0) packs a primary/secondary/tertiary weight
+//     triple, as used for the common case of a single rune with no
+//     contraction, expansion or decomposition:
+//
+//     30            11 10      5 4    0
+//     [   primary    ][secondary][tertiary]
+//
+//   - A special CE (bit 31 == 1) instead holds a pointer into one of the
+//     side tables built up alongside the trie:
+//
+//     30  29 28                        0
+//     [kind][        payload           ]
+//
+//     kind identifies which side table the payload indexes: expansion,
+//     contraction or decomposition. Builder never needs to tell a weight CE
+//     from a special one by inspection (the trie and Overlay only ever
+//     treat a CE as an opaque uint32 to look up and hand back), so the two
+//     encodings only need to avoid colliding with each other, not to be
+//     self-describing.
+const (
+	primaryBits   = 20
+	secondaryBits = 6
+	tertiaryBits  = 5
+
+	maxPrimary   = 1<<primaryBits - 1
+	maxSecondary = 1<<secondaryBits - 1
+	maxTertiary  = 1<<tertiaryBits - 1 // 0x1F, the common DUCET tertiary ceiling
+
+	// defaultSecondary and defaultTertiary are the weights Add and
+	// insertTailoring fall back to when a collation element only specifies
+	// a primary weight, matching the common-case DUCET weights of 0020 and
+	// 0002.
+	defaultSecondary = 0x20
+	defaultTertiary  = 0x02
+
+	specialBit = 1 << 31
+	kindBits   = 2
+	kindShift  = 31 - kindBits
+	payloadMax = 1<<kindShift - 1
+
+	expandKind        = 0
+	contractKind      = 1
+	decomposeKind     = 2
+	handleBits        = 14
+	contractIndexBits = kindShift - handleBits
+)
+
+// illegalOffset is added to a code point's raw primary weight, after
+// subtracting illegalPrimary (see convertLargeWeights), to map reserved or
+// illegal code points to our own representation. It sits at the very top of
+// the primary weight range so they always sort after every assigned or
+// implicit weight.
+const illegalOffset = maxPrimary - 1
+
+// firstImplicitPrimary is the base of the primary weight range used for
+// runes that have no explicit entry (see genColElems): code points the
+// Builder was never told about sort in code point order, after every
+// explicit entry and before the illegalOffset range.
+const firstImplicitPrimary = 0x4000
+
+// implicitPrimary returns the primary weight used for a rune that has no
+// entry of its own, per the general idea of UCA's implicit weight
+// assignment (see http://unicode.org/reports/tr10/#Implicit_Weights):
+// unassigned code points are ordered among themselves, by code point, in a
+// reserved range after all explicitly tailored primaries.
+func implicitPrimary(r rune) int {
+	return (firstImplicitPrimary + int(r)) & maxPrimary
+}
+
+// makeCE packs the primary, secondary and tertiary weights in w (w[0], w[1]
+// and w[2]; any further elements, such as the original rune genColElems
+// stashes at w[3] for uniqueness, are ignored) into a single weight CE.
+func makeCE(w []int) (uint32, error) {
+	if w[0] < 0 || w[0] > maxPrimary {
+		return 0, fmt.Errorf("makeCE: primary weight out of bounds: %#x", w[0])
+	}
+	if w[1] < 0 || w[1] > maxSecondary {
+		return 0, fmt.Errorf("makeCE: secondary weight out of bounds: %#x", w[1])
+	}
+	if w[2] < 0 || w[2] > maxTertiary {
+		return 0, fmt.Errorf("makeCE: tertiary weight out of bounds: %#x", w[2])
+	}
+	ce := uint32(w[0])<<(secondaryBits+tertiaryBits) | uint32(w[1])<<tertiaryBits | uint32(w[2])
+	return ce, nil
+}
+
+// makeExpandIndex returns the special CE pointing at the expansion recorded
+// at index in t.expandIndex/t.expandLen.
+func makeExpandIndex(index int) (uint32, error) {
+	if index < 0 || index > payloadMax {
+		return 0, fmt.Errorf("makeExpandIndex: index out of bounds: %#x", index)
+	}
+	return specialBit | expandKind<<kindShift | uint32(index), nil
+}
+
+// makeContractIndex returns the special CE pointing a contraction starter
+// at the suffix trie h and the block of collation elements recorded at
+// index in t.contractElem.
+func makeContractIndex(h ctHandle, index int) (uint32, error) {
+	if h.n < 0 || h.n > 1<<handleBits-1 {
+		return 0, fmt.Errorf("makeContractIndex: handle out of bounds: %#x", h.n)
+	}
+	if index < 0 || index > 1<<contractIndexBits-1 {
+		return 0, fmt.Errorf("makeContractIndex: index out of bounds: %#x", index)
+	}
+	return specialBit | contractKind<<kindShift | uint32(h.n)<<contractIndexBits | uint32(index), nil
+}
+
+// makeDecompose returns the special CE recording that an entry's collation
+// elements can be regenerated from its NFKD decomposition, together with
+// the tertiary weights (t1 for the entry itself, t2 for the decomposition's
+// second collation element, if any) that distinguish it from its
+// decomposition at the tertiary level. See reproducibleFromNFKD.
+func makeDecompose(t1, t2 int) (uint32, error) {
+	if t1 < 0 || t1 > maxTertiary {
+		return 0, fmt.Errorf("makeDecompose: t1 out of bounds: %#x", t1)
+	}
+	if t2 < 0 || t2 > maxTertiary {
+		return 0, fmt.Errorf("makeDecompose: t2 out of bounds: %#x", t2)
+	}
+	return specialBit | decomposeKind<<kindShift | uint32(t1)<<tertiaryBits | uint32(t2), nil
+}
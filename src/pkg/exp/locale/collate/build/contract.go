@@ -0,0 +1,45 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+// ctHandle identifies one contraction suffix set appended to a
+// contractTrieSet, as returned by contractTrieSet.appendTrie.
+type ctHandle struct {
+	n int
+}
+
+// contractTrieSet holds, for each distinct contraction suffix set added via
+// appendTrie, the list of suffixes in that set.  Several starter runes
+// commonly share an identical suffix set (see processContractions), so
+// callers intern by content and reuse the resulting handle rather than
+// appending duplicates.
+type contractTrieSet struct {
+	sets [][]string
+}
+
+// appendTrie records a new suffix set and returns a handle for it.  Handles
+// start at 1: sets[0] is left empty, so that the zero ctHandle, which
+// entry.contractionStarter reads as "not a contraction starter", never
+// refers to a real suffix set.
+func (s *contractTrieSet) appendTrie(suffixes []string) (ctHandle, error) {
+	if len(s.sets) == 0 {
+		s.sets = append(s.sets, nil)
+	}
+	h := ctHandle{n: len(s.sets)}
+	s.sets = append(s.sets, append([]string(nil), suffixes...))
+	return h, nil
+}
+
+// lookup reports the 1-based position of str within the suffix set h
+// refers to (0 if str matches none of them, i.e. only the starter rune
+// itself applies) and the number of bytes of str that matched.
+func (s *contractTrieSet) lookup(h ctHandle, str []byte) (offset, n int) {
+	for i, suffix := range s.sets[h.n] {
+		if string(str) == suffix {
+			return i + 1, len(str)
+		}
+	}
+	return 0, 0
+}
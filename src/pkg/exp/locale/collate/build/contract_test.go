@@ -0,0 +1,32 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import "testing"
+
+func TestContractTrieSet(t *testing.T) {
+	var s contractTrieSet
+	h1, err := s.appendTrie([]string{"a", "bb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := s.appendTrie([]string{"c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off, n := s.lookup(h1, []byte("a")); off != 1 || n != 1 {
+		t.Errorf("lookup(h1, %q) = %d, %d; want 1, 1", "a", off, n)
+	}
+	if off, n := s.lookup(h1, []byte("bb")); off != 2 || n != 2 {
+		t.Errorf("lookup(h1, %q) = %d, %d; want 2, 2", "bb", off, n)
+	}
+	if off, _ := s.lookup(h1, []byte("c")); off != 0 {
+		t.Errorf("lookup(h1, %q) = %d; want 0 (not in h1's set)", "c", off)
+	}
+	if off, n := s.lookup(h2, []byte("c")); off != 1 || n != 1 {
+		t.Errorf("lookup(h2, %q) = %d, %d; want 1, 1", "c", off, n)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"io"
+)
+
+// table holds the generated collation data for a single locale: a compact
+// trie mapping starter runes to collation elements, plus the expansion and
+// contraction side tables a collation element may point into.  finish
+// builds a table from a Builder's processed entries; Build and Print both
+// turn a table into something callers can use, either in memory (via
+// collate.Init) or as generated Go source (via print).
+type table struct {
+	index          trieIndex
+	expandCE       []uint32
+	expandIndex    []uint16
+	expandLen      []uint8
+	contractElem   []uint32
+	contractTries  contractTrieSet
+	maxContractLen int
+}
+
+// Lookup implements collate.Weights: it returns the collation element
+// recorded for r's starter trie entry, if any.
+func (t *table) Lookup(r rune) (ce uint32, found bool) {
+	return t.index.lookup(r)
+}
+
+// print writes t as a Go source variable declaration named name to w, in a
+// form that can be compiled into the collate package and passed to Init.
+// It returns the number of bytes written.
+func (t *table) print(w io.Writer, name string) (n int, _ int, err error) {
+	n, err = fmt.Fprintf(w, "var %s = table{\n\tindex: %#v,\n\texpandCE: %#v,\n\texpandIndex: %#v,\n\texpandLen: %#v,\n\tcontractElem: %#v,\n\tmaxContractLen: %d,\n}\n\n",
+		name, t.index, t.expandCE, t.expandIndex, t.expandLen, t.contractElem, t.maxContractLen)
+	return n, 0, err
+}
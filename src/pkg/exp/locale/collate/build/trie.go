@@ -0,0 +1,201 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import "sort"
+
+// trieBlockSize is the number of consecutive rune values encoded together
+// as one trieBlock. Blocks are the unit generate's compaction operates on.
+const trieBlockSize = 64
+
+// node accumulates rune -> collation element associations during
+// buildTrie, before generate compacts them into a trieIndex.
+type node struct {
+	values map[rune]uint32
+}
+
+func newNode() *node {
+	return &node{values: make(map[rune]uint32)}
+}
+
+func (n *node) insert(r rune, ce uint32) {
+	n.values[r] = ce
+}
+
+// blockKind identifies how a trieBlock encodes the trieBlockSize values
+// of the block of runes it covers.
+type blockKind byte
+
+const (
+	// denseBlock stores one uint32 per rune in the block, 0 meaning "no
+	// value"; the fallback for blocks the other two kinds don't fit.
+	denseBlock blockKind = iota
+	// sparseBlock stores only the (offset, value) pairs that are set, for
+	// blocks where few of the trieBlockSize runes have a value -- the
+	// common case, since most of the DUCET's runes are unassigned.
+	sparseBlock
+	// strideBlock stores a single base/stride/length triple for a run of
+	// runes whose values increase by a constant step, e.g. the large
+	// contiguous CJK and Hangul ranges, whose implicit primary weights
+	// are a linear function of the rune value.
+	strideBlock
+)
+
+type trieBlock struct {
+	kind blockKind
+
+	dense []uint32 // denseBlock
+
+	offset []uint8  // sparseBlock: rune offsets within the block that are set
+	value  []uint32 // sparseBlock: parallel to offset
+
+	start  int    // strideBlock: first offset in the block that is set
+	n      int    // strideBlock: number of consecutive runes from start that are set
+	base   uint32 // strideBlock: value at offset start
+	stride uint32 // strideBlock: value delta per rune
+}
+
+// lookup returns the value stored at off within the block, or 0, false if
+// none was set there.
+func (blk trieBlock) lookup(off int) (uint32, bool) {
+	switch blk.kind {
+	case denseBlock:
+		if v := blk.dense[off]; v != 0 {
+			return v, true
+		}
+	case sparseBlock:
+		i := sort.Search(len(blk.offset), func(i int) bool { return int(blk.offset[i]) >= off })
+		if i < len(blk.offset) && int(blk.offset[i]) == off {
+			return blk.value[i], true
+		}
+	case strideBlock:
+		if d := off - blk.start; d >= 0 && d < blk.n {
+			return blk.base + blk.stride*uint32(d), true
+		}
+	}
+	return 0, false
+}
+
+// trieIndex is the compact, queryable form of a node's accumulated
+// rune->CE mapping, as produced by node.generate.
+type trieIndex struct {
+	// blocks is keyed by rune / trieBlockSize and holds trieBlock values,
+	// not pointers, so that table.print's "%#v" emits a literal composite
+	// value for every block instead of falling back to a raw pointer
+	// address for anything but the map itself.
+	blocks map[rune]trieBlock
+}
+
+// lookup returns the collation element recorded for r, or 0, false if r
+// was never inserted.
+func (t trieIndex) lookup(r rune) (uint32, bool) {
+	blk, ok := t.blocks[r/trieBlockSize]
+	if !ok {
+		return 0, false
+	}
+	return blk.lookup(int(r % trieBlockSize))
+}
+
+// generate compacts n's accumulated values into a trieIndex, choosing an
+// encoding with compactBlock for each block of trieBlockSize consecutive
+// runes that has at least one value.
+func (n *node) generate() (*trieIndex, error) {
+	byBlock := make(map[rune][]uint32)
+	for r, ce := range n.values {
+		b := r / trieBlockSize
+		dense, ok := byBlock[b]
+		if !ok {
+			dense = make([]uint32, trieBlockSize)
+			byBlock[b] = dense
+		}
+		dense[r%trieBlockSize] = ce
+	}
+	idx := &trieIndex{blocks: make(map[rune]trieBlock, len(byBlock))}
+	for b, dense := range byBlock {
+		idx.blocks[b] = *compactBlock(dense)
+	}
+	return idx, nil
+}
+
+// compactBlock picks a trieBlock encoding that can losslessly represent
+// dense, a run of trieBlockSize values (one per rune in the block, 0
+// meaning "no value"): strideBlock whenever asStrideBlock accepts dense,
+// otherwise sparseBlock if at most a quarter of the values are set, and
+// denseBlock otherwise.  This is not always the smallest encoding.
+func compactBlock(dense []uint32) *trieBlock {
+	if blk, ok := asStrideBlock(dense); ok {
+		return blk
+	}
+	nonZero := 0
+	for _, v := range dense {
+		if v != 0 {
+			nonZero++
+		}
+	}
+	// A sparseBlock entry costs a uint8 plus a uint32; only worth it once
+	// a denseBlock's uint32-per-rune would cost noticeably more.
+	if nonZero*4 <= len(dense) {
+		blk := &trieBlock{kind: sparseBlock}
+		for i, v := range dense {
+			if v != 0 {
+				blk.offset = append(blk.offset, uint8(i))
+				blk.value = append(blk.value, v)
+			}
+		}
+		return blk
+	}
+	return &trieBlock{kind: denseBlock, dense: dense}
+}
+
+// minStrideRun is the minimum number of consecutive constant-stride runes
+// worth encoding as a strideBlock instead of falling through to sparse or
+// dense; shorter runs don't recoup the cost of the block header.
+const minStrideRun = 4
+
+// asStrideBlock reports whether dense has no set value outside of some run
+// of at least minStrideRun consecutive runes whose values increase by a
+// single constant stride, and if so returns the strideBlock encoding it.
+// A strideBlock can only represent such a run plus implicit zeros on
+// either side of it, so unlike denseBlock and sparseBlock it cannot be
+// used for a block that has any other value outside that run.
+func asStrideBlock(dense []uint32) (*trieBlock, bool) {
+	bestStart, bestN := 0, 0
+	nonZero := 0
+	for i := 0; i < len(dense); {
+		if dense[i] == 0 {
+			i++
+			continue
+		}
+		nonZero++
+		start := i
+		n := 1
+		i++
+		stride := uint32(0)
+		for i < len(dense) && dense[i] != 0 {
+			d := dense[i] - dense[i-1]
+			if n == 1 {
+				stride = d
+			} else if d != stride {
+				break
+			}
+			n++
+			i++
+			nonZero++
+		}
+		if n > bestN {
+			bestStart, bestN = start, n
+		}
+	}
+	if bestN < minStrideRun || bestN != nonZero {
+		return nil, false
+	}
+	return &trieBlock{
+		kind:   strideBlock,
+		start:  bestStart,
+		n:      bestN,
+		base:   dense[bestStart],
+		stride: dense[bestStart+1] - dense[bestStart],
+	}, true
+}
@@ -0,0 +1,163 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import "testing"
+
+func TestCompactBlockDense(t *testing.T) {
+	// Too many distinct, non-constant-stride values to pass as sparse or
+	// stride: falls through to denseBlock.
+	dense := make([]uint32, trieBlockSize)
+	for i := range dense {
+		dense[i] = uint32(i*i + 1)
+	}
+	blk := compactBlock(dense)
+	if blk.kind != denseBlock {
+		t.Fatalf("kind = %v; want denseBlock", blk.kind)
+	}
+	for i, want := range dense {
+		if got, ok := blk.lookup(i); !ok || got != want {
+			t.Errorf("lookup(%d) = %d, %v; want %d, true", i, got, ok, want)
+		}
+	}
+}
+
+func TestCompactBlockSparse(t *testing.T) {
+	dense := make([]uint32, trieBlockSize)
+	dense[3] = 7
+	dense[40] = 99
+	blk := compactBlock(dense)
+	if blk.kind != sparseBlock {
+		t.Fatalf("kind = %v; want sparseBlock", blk.kind)
+	}
+	for i, want := range dense {
+		got, ok := blk.lookup(i)
+		if want == 0 {
+			if ok {
+				t.Errorf("lookup(%d) = %d, true; want not found", i, got)
+			}
+			continue
+		}
+		if !ok || got != want {
+			t.Errorf("lookup(%d) = %d, %v; want %d, true", i, got, ok, want)
+		}
+	}
+}
+
+func TestCompactBlockStride(t *testing.T) {
+	// A long constant-stride run, as occurs for CJK/Hangul-style implicit
+	// primary weights, with nothing else set in the block.
+	dense := make([]uint32, trieBlockSize)
+	for i := 10; i < 30; i++ {
+		dense[i] = uint32(1000 + 3*i)
+	}
+	blk := compactBlock(dense)
+	if blk.kind != strideBlock {
+		t.Fatalf("kind = %v; want strideBlock", blk.kind)
+	}
+	for i, want := range dense {
+		got, ok := blk.lookup(i)
+		if want == 0 {
+			if ok {
+				t.Errorf("lookup(%d) = %d, true; want not found", i, got)
+			}
+			continue
+		}
+		if !ok || got != want {
+			t.Errorf("lookup(%d) = %d, %v; want %d, true", i, got, ok, want)
+		}
+	}
+}
+
+// TestCompactBlockStrideWithOutlier guards against the stride encoding
+// dropping values outside its run: a block with a long constant-stride run
+// plus one unrelated value elsewhere must not be encoded as a strideBlock,
+// since strideBlock can only represent the run itself.
+func TestCompactBlockStrideWithOutlier(t *testing.T) {
+	dense := make([]uint32, trieBlockSize)
+	for i := 10; i < 30; i++ {
+		dense[i] = uint32(1000 + 3*i)
+	}
+	dense[50] = 42 // outside the stride run
+	blk := compactBlock(dense)
+	if blk.kind == strideBlock {
+		t.Fatalf("kind = strideBlock; would silently drop dense[50]")
+	}
+	for i, want := range dense {
+		got, ok := blk.lookup(i)
+		if want == 0 {
+			if ok {
+				t.Errorf("lookup(%d) = %d, true; want not found", i, got)
+			}
+			continue
+		}
+		if !ok || got != want {
+			t.Errorf("lookup(%d) = %d, %v; want %d, true", i, got, ok, want)
+		}
+	}
+}
+
+func TestTrieIndexLookup(t *testing.T) {
+	n := newNode()
+	n.insert('a', 1)
+	n.insert('b', 2)
+	n.insert(rune(2*trieBlockSize+5), 3) // lands in a different block
+	idx, err := n.generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, want := range map[rune]uint32{'a': 1, 'b': 2, rune(2*trieBlockSize + 5): 3} {
+		if got, ok := idx.lookup(r); !ok || got != want {
+			t.Errorf("lookup(%q) = %d, %v; want %d, true", r, got, ok, want)
+		}
+	}
+	if _, ok := idx.lookup('z'); ok {
+		t.Errorf("lookup('z') found a value; want not found")
+	}
+}
+
+// benchBlock builds a *trieBlock of the given kind to benchmark lookup
+// against, independent of compactBlock's own choice, so each kind's cost
+// can be compared directly.
+func benchBlock(kind blockKind) *trieBlock {
+	switch kind {
+	case denseBlock:
+		dense := make([]uint32, trieBlockSize)
+		for i := range dense {
+			dense[i] = uint32(i*7 + 1)
+		}
+		return &trieBlock{kind: denseBlock, dense: dense}
+	case sparseBlock:
+		blk := &trieBlock{kind: sparseBlock}
+		for i := 0; i < trieBlockSize; i += 16 {
+			blk.offset = append(blk.offset, uint8(i))
+			blk.value = append(blk.value, uint32(i+1))
+		}
+		return blk
+	case strideBlock:
+		return &trieBlock{kind: strideBlock, start: 0, n: trieBlockSize, base: 1, stride: 3}
+	}
+	panic("unreachable")
+}
+
+func BenchmarkTrieLookupDense(b *testing.B) {
+	benchmarkTrieLookup(b, denseBlock)
+}
+
+func BenchmarkTrieLookupSparse(b *testing.B) {
+	benchmarkTrieLookup(b, sparseBlock)
+}
+
+func BenchmarkTrieLookupStride(b *testing.B) {
+	benchmarkTrieLookup(b, strideBlock)
+}
+
+func benchmarkTrieLookup(b *testing.B, kind blockKind) {
+	blk := benchBlock(kind)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		blk.lookup(i % trieBlockSize)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package collate contains types for comparing and sorting Unicode strings
+// according to a given collation order.
+package collate
+
+// Level identifies a level of collation comparison, as defined by the
+// Unicode Collation Algorithm. Tailorings (see exp/locale/collate/build)
+// are specified relative to one of these levels.  Collator in this package
+// only looks up collation elements; it has no string comparison method.
+// See http://www.unicode.org/reports/tr10/#Multi_Level_Comparison.
+type Level int
+
+const (
+	Identity Level = iota
+	Primary
+	Secondary
+	Tertiary
+	Quaternary
+)
+
+// Weights is the minimal interface Init needs from a base table or a
+// locale's tailoring: a way to look up the collation element recorded for
+// a starter rune. The unexported table type and the Overlay type in
+// exp/locale/collate/build both implement it. It is declared as an
+// interface, rather than Init simply taking a concrete build type,
+// because build already imports this package for Level; accepting a
+// build type here by name would make that an import cycle.
+type Weights interface {
+	Lookup(r rune) (ce uint32, found bool)
+}
+
+// Collator compares strings according to a collation order built from a
+// base table, optionally patched by one locale's tailoring.
+type Collator struct {
+	base    Weights
+	overlay Weights
+}
+
+// Init creates a Collator for base, optionally patched by the tailoring
+// recorded in a single overlay. Passing no overlay returns a Collator for
+// base itself, e.g. the root collation order.
+func Init(base Weights, overlay ...Weights) *Collator {
+	c := &Collator{base: base}
+	if len(overlay) > 0 {
+		c.overlay = overlay[0]
+	}
+	return c
+}
+
+// lookup returns the collation element for r, preferring the overlay's
+// weights over the base table's where the overlay has one.
+func (c *Collator) lookup(r rune) (ce uint32, found bool) {
+	if c.overlay != nil {
+		if ce, found = c.overlay.Lookup(r); found {
+			return ce, true
+		}
+	}
+	return c.base.Lookup(r)
+}